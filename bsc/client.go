@@ -1,12 +1,15 @@
 package bsc
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/html"
 )
@@ -14,21 +17,93 @@ import (
 var redirectionRejectedError = errors.New("redirect occurred")
 var scheduleListViewPath string = "/EMPLOYEE/HRMS/c/SA_LEARNER_SERVICES.SSR_SSENRL_LIST.GBL?Page=SSR_SSENRL_LIST"
 
+// SSOEngine may optionally be implemented by a UniversityEngine whose Student Center sits behind
+// a Shibboleth/SAML (or similar) identity provider. When present, redirects encountered while
+// authenticating (on the http.Client returned by AuthenticatingClient) are routed through
+// FollowRedirect instead of being unconditionally rejected, so the engine can allow the IdP/SP hops its login flow needs while still rejecting redirect loops
+// or hops to unexpected hosts. Redirects on content requests (RequestPage, RequestPagePost) are
+// always rejected.
+//
+// FollowRedirect has the same contract as http.Client's CheckRedirect: returning nil allows the
+// redirect, any other error aborts it.
+type SSOEngine interface {
+	FollowRedirect(req *http.Request, via []*http.Request) error
+}
+
 // A Client makes requests to a University's Student Center.
 type Client struct {
 	// authLock ensures that no concurrent requests are made during the re-authentication process.
 	// It also ensures that the client does not authenticate more than once concurrently.
 	authLock sync.RWMutex
 
-	client   http.Client
-	username string
-	password string
-	uni      UniversityEngine
+	// client is used for ordinary content requests (RequestPage, RequestPagePost). It always
+	// rejects redirects: a redirect there means the session expired, and RequestPageContext /
+	// RequestPagePostContext need to see that as an error so they know to re-authenticate.
+	client http.Client
+
+	// authClient is used only for the authentication round-trip itself (postGenericLoginForm,
+	// and exposed to UniversityEngine implementations via AuthenticatingClient). If uni
+	// implements SSOEngine, its FollowRedirect hook decides which redirects to follow here —
+	// but only here, never on content requests.
+	authClient http.Client
+
+	creds CredentialProvider
+	uni   UniversityEngine
+
+	// requestTimeout, if non-zero, bounds the entire call made through the context-less methods
+	// (RequestPage, RequestPagePost, Authenticate, FetchSchedule) - including every retry,
+	// backoff sleep, and the bonus re-authentication attempt, not just the first HTTP round
+	// trip. FetchSchedule's extra per-course requests (fetchMoreInfo) are not bound by it. Set via
+	// WithTimeout.
+	requestTimeout time.Duration
+
+	// retryPolicy governs how RequestPageContext/RequestPagePostContext retry transient
+	// failures. Defaults to defaultRetryPolicy; set via WithRetryPolicy.
+	retryPolicy RetryPolicy
+
+	// sessionStore, if set, persists the cookie jar across process restarts. Set via
+	// WithSessionStore.
+	sessionStore SessionStore
+
+	// originsMu guards knownOrigins.
+	originsMu sync.Mutex
+
+	// knownOrigins records every distinct scheme://host the Client has talked to, on both
+	// client and authClient, so saveSession can persist cookies for hosts other than just the
+	// PeopleSoft root — notably an SSO identity provider.
+	knownOrigins map[string]*url.URL
+}
+
+// ClientOption configures optional behavior on a Client constructed by NewClient.
+type ClientOption func(*Client)
+
+// WithTimeout bounds each call made through the context-less methods (RequestPage,
+// RequestPagePost, Authenticate, FetchSchedule) by a deadline of d. This covers the whole call,
+// not just a single HTTP round trip: with the default RetryPolicy, a call that hits transient
+// failures can retry several times with backoff, and a detected session expiry triggers a bonus
+// re-authentication, all before d elapses. Size d accordingly, or use WithRetryPolicy to bound the
+// number of attempts instead. WithTimeout has no effect on the …Context variants, which honor
+// whatever deadline the caller's context already carries. The extra per-course requests that
+// FetchSchedule makes when fetchMoreInfo is true are not bound by d.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.requestTimeout = d
+	}
+}
+
+// WithSessionStore rehydrates the cookie jar from store on construction and persists it after
+// each successful Authenticate and after each RequestPage/RequestPagePost call that actually set
+// new cookies, so a short-lived process doesn't have to re-authenticate on every invocation.
+func WithSessionStore(store SessionStore) ClientOption {
+	return func(c *Client) {
+		c.sessionStore = store
+	}
 }
 
-// NewClient creates a new Client which authenticates with the supplied username, password, and
-// UniversityEngine.
-func NewClient(username, password string, uni UniversityEngine) *Client {
+// NewClient creates a new Client which authenticates with the supplied CredentialProvider and
+// UniversityEngine. For a plain username/password pair, pass StaticCredentials(username,
+// password).
+func NewClient(creds CredentialProvider, uni UniversityEngine, opts ...ClientOption) *Client {
 	jar, _ := cookiejar.New(nil)
 
 	tlsConfig := tls.Config{
@@ -54,12 +129,127 @@ func NewClient(username, password string, uni UniversityEngine) *Client {
 		TLSClientConfig: &tlsConfig,
 	}
 
-	httpClient := http.Client{
-		Jar: jar,
+	c := &Client{
+		creds:        creds,
+		uni:          uni,
+		retryPolicy:  defaultRetryPolicy,
+		knownOrigins: map[string]*url.URL{},
+	}
+	recordingTransport := &originRecordingTransport{base: transport, record: c.recordOrigin}
+	c.client = http.Client{
+		Jar:           jar,
 		CheckRedirect: rejectRedirect,
-		Transport: transport,
+		Transport:     recordingTransport,
+	}
+	c.authClient = http.Client{
+		Jar:           jar,
+		CheckRedirect: c.checkRedirect,
+		Transport:     recordingTransport,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.loadSession()
+	return c
+}
+
+// checkRedirect is installed as authClient's CheckRedirect, i.e. it only ever runs while
+// authenticating. If the Client's UniversityEngine implements SSOEngine, the decision is
+// delegated to it so the IdP/SP redirect chain can be followed; otherwise every redirect is
+// rejected, same as on the content client.
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if sso, ok := c.uni.(SSOEngine); ok {
+		return sso.FollowRedirect(req, via)
+	}
+	return rejectRedirect(req, via)
+}
+
+// originRecordingTransport wraps an http.RoundTripper and reports every request's origin to
+// record, so the Client can later persist cookies for hosts beyond just the PeopleSoft root (an
+// SSO identity provider, notably) without needing every call site to track that itself.
+type originRecordingTransport struct {
+	base   http.RoundTripper
+	record func(*url.URL)
+}
+
+func (t *originRecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.record(req.URL)
+	return t.base.RoundTrip(req)
+}
+
+// recordOrigin adds u's origin (scheme + host) to c.knownOrigins.
+func (c *Client) recordOrigin(u *url.URL) {
+	if u == nil {
+		return
 	}
-	return &Client{sync.RWMutex{}, httpClient, username, password, uni}
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	c.originsMu.Lock()
+	defer c.originsMu.Unlock()
+	c.knownOrigins[origin.String()] = origin
+}
+
+// loadSession rehydrates the cookie jar from c.sessionStore, if one is configured, restoring
+// cookies for every host the store has, not just the PeopleSoft root. An error from the store, or
+// the absence of a stored session, just leaves the jar empty, the same as without a store; a
+// stored host whose origin does not parse is skipped.
+func (c *Client) loadSession() {
+	if c.sessionStore == nil {
+		return
+	}
+	hosts, err := c.sessionStore.Load()
+	if err != nil {
+		return
+	}
+	for _, host := range hosts {
+		origin, err := url.Parse(host.Origin)
+		if err != nil {
+			continue
+		}
+		c.client.Jar.SetCookies(origin, host.Cookies)
+		c.recordOrigin(origin)
+	}
+}
+
+// saveSession persists the cookie jar to c.sessionStore, if one is configured, across every host
+// the Client has talked to (see knownOrigins), not just the PeopleSoft root.
+func (c *Client) saveSession() {
+	if c.sessionStore == nil {
+		return
+	}
+
+	c.originsMu.Lock()
+	origins := make([]*url.URL, 0, len(c.knownOrigins))
+	for _, origin := range c.knownOrigins {
+		origins = append(origins, origin)
+	}
+	c.originsMu.Unlock()
+
+	hosts := make([]HostCookies, 0, len(origins))
+	for _, origin := range origins {
+		cookies := c.client.Jar.Cookies(origin)
+		if len(cookies) == 0 {
+			continue
+		}
+		hosts = append(hosts, HostCookies{Origin: origin.String(), Cookies: cookies})
+	}
+	_ = c.sessionStore.Save(hosts)
+}
+
+// saveSessionIfChanged persists the cookie jar if resp actually set any cookies.
+func (c *Client) saveSessionIfChanged(resp *http.Response) {
+	if resp == nil || len(resp.Header.Values("Set-Cookie")) == 0 {
+		return
+	}
+	c.saveSession()
+}
+
+// boundContext derives a context from ctx that additionally respects c.requestTimeout, if one was
+// configured via WithTimeout. The returned cancel func must always be called by the caller.
+func (c *Client) boundContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
 }
 
 // Authenticate authenticates with the university's server.
@@ -67,122 +257,192 @@ func NewClient(username, password string, uni UniversityEngine) *Client {
 // You should call this after creating a Client. However, if you do not, it will automatically be
 // called after the first request fails.
 func (c *Client) Authenticate() error {
+	ctx, cancel := c.boundContext(context.Background())
+	defer cancel()
+	return c.AuthenticateContext(ctx)
+}
+
+// AuthenticateContext is like Authenticate, but aborts as soon as ctx is done.
+func (c *Client) AuthenticateContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+	// NOTE: this widens UniversityEngine.Authenticate's contract to
+	// Authenticate(ctx context.Context, c *Client) error, so the round-trip the engine performs
+	// can honor cancellation and WithTimeout end-to-end instead of only being checked once
+	// before the write lock is acquired. Every UniversityEngine implementation (ShibbolethEngine
+	// included) needs to accept ctx and pass it down to its own requests.
+	if err := c.uni.Authenticate(ctx, c); err != nil {
+		return err
+	}
+	c.saveSession()
+	return nil
+}
+
+// Logout clears the cookie jar and removes any persisted session, so the next request starts a
+// fresh, unauthenticated session.
+func (c *Client) Logout() error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
-	return c.uni.Authenticate(c)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	c.client.Jar = jar
+	c.authClient.Jar = jar
+
+	if c.sessionStore == nil {
+		return nil
+	}
+	return c.sessionStore.Delete()
 }
 
 // FetchCurrentSchedule downloads the user's current schedule.
 //
 // If fetchMoreInfo is true, the components of each course will have extra information.
 func (c *Client) FetchSchedule(fetchMoreInfo bool) ([]Course, error) {
+	ctx, cancel := c.boundContext(context.Background())
+	defer cancel()
+	return c.FetchScheduleContext(ctx, fetchMoreInfo)
+}
+
+// FetchScheduleContext is like FetchSchedule, but binds the schedule list request (and its
+// retries and re-auth attempt) to ctx. The extra per-course requests made when fetchMoreInfo is
+// true are not bound to ctx.
+func (c *Client) FetchScheduleContext(ctx context.Context, fetchMoreInfo bool) ([]Course, error) {
 	// TODO: GET page, then check if a <form> exists, then extract the name of the radio buttons?
 	postData := url.Values{}
 	postData.Add("SSR_DUMMY_RECV1$sels$0", "0")
 
-	if resp, err := c.RequestPagePost(scheduleListViewPath, postData); err != nil {
+	resp, err := c.RequestPagePostContext(ctx, scheduleListViewPath, postData)
+	if err != nil {
 		return nil, err
-	} else {
-		defer resp.Body.Close()
-
-		contents, err := ioutil.ReadAll(resp.Body)
-		fmt.Println(string(contents))
+	}
+	defer resp.Body.Close()
 
-		nodes, err := html.ParseFragment(resp.Body, nil)
-		if err != nil {
-			return nil, err
-		}
-		if len(nodes) != 1 {
-			return nil, errors.New("invalid number of root elements")
-		}
+	nodes, err := html.ParseFragment(resp.Body, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) != 1 {
+		return nil, errors.New("invalid number of root elements")
+	}
 
-		courses, err := parseSchedule(nodes[0])
-		if err != nil {
+	courses, err := parseSchedule(nodes[0])
+	if err != nil {
+		return nil, err
+	}
+	if fetchMoreInfo {
+		c.authLock.RLock()
+		defer c.authLock.RUnlock()
+		if err := fetchExtraScheduleInfo(&c.client, courses, nodes[0]); err != nil {
 			return nil, err
 		}
-		if fetchMoreInfo {
-			c.authLock.RLock()
-			defer c.authLock.RUnlock()
-			if err := fetchExtraScheduleInfo(&c.client, courses, nodes[0]); err != nil {
-				return nil, err
-			}
-		}
-		return courses, nil
 	}
+	return courses, nil
 }
 
 // RequestPage requests a page relative to the PeopleSoft root. This will automatically
 // re-authenticate if the session has timed out.
 // If the request fails for any reason (including a redirect), the returned response is nil.
 func (c *Client) RequestPage(page string) (*http.Response, error) {
-	requestURL := c.uni.RootURL() + page
-	c.authLock.RLock()
-	resp, err := c.client.Get(requestURL)
-	c.authLock.RUnlock()
-	if err != nil && !isRedirectError(err) {
-		return nil, err
-	} else if err == nil {
-		return resp, nil
-	}
+	ctx, cancel := c.boundContext(context.Background())
+	defer cancel()
+	return c.RequestPageContext(ctx, page)
+}
 
-	resp.Body.Close()
+// RequestPageContext is like RequestPage, but binds the request (and any retries or the re-auth
+// attempt) to ctx. A cancelled or expired ctx aborts the retry loop, including any in-progress
+// backoff sleep.
+func (c *Client) RequestPageContext(ctx context.Context, page string) (*http.Response, error) {
+	requestURL := c.uni.RootURL() + page
+	return c.requestWithRetry(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	})
+}
 
-	if err := c.Authenticate(); err != nil {
-		return nil, err
-	}
+// RequestPagePost requests a page relative to the PeopleSoft root via a POST of postData. This
+// will automatically re-authenticate if the session has timed out.
+func (c *Client) RequestPagePost(page string, postData url.Values) (*http.Response, error) {
+	ctx, cancel := c.boundContext(context.Background())
+	defer cancel()
+	return c.RequestPagePostContext(ctx, page, postData)
+}
 
-	c.authLock.RLock()
-	resp, err = c.client.Get(requestURL)
-	c.authLock.RUnlock()
-	if err != nil {
-		if resp != nil {
-			resp.Body.Close()
+// RequestPagePostContext is like RequestPagePost, but binds the request (and any retries or the
+// re-auth attempt) to ctx. A cancelled or expired ctx aborts the retry loop, including any
+// in-progress backoff sleep.
+func (c *Client) RequestPagePostContext(ctx context.Context, page string, postData url.Values) (*http.Response, error) {
+	requestURL := c.uni.RootURL() + page
+	encodedForm := postData.Encode()
+	return c.requestWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, strings.NewReader(encodedForm))
+		if err != nil {
+			return nil, err
 		}
-		return nil, err
-	} else {
-		return resp, nil
-	}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
 }
 
-func (c *Client) RequestPagePost(page string, postData url.Values) (*http.Response, error) {
-	requestURL := c.uni.RootURL() + page
+// do performs req while holding authLock for reading, so no concurrent re-authentication can
+// invalidate the session mid-request.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
 	c.authLock.RLock()
-	resp, err := c.client.PostForm(requestURL, postData)
-	c.authLock.RUnlock()
-	if err != nil && !isRedirectError(err) {
-		return nil, err
-	} else if err == nil {
-		return resp, nil
-	}
+	defer c.authLock.RUnlock()
+	return c.client.Do(req)
+}
 
-	resp.Body.Close()
+// AuthenticatingClient exposes authClient for use by UniversityEngine implementations defined
+// outside this package (such as bsc/sso.ShibbolethEngine) while they are running inside
+// Authenticate. authLock is held in write mode for the duration of Authenticate, so engines must
+// make any extra requests of their own directly through this http.Client rather than through
+// RequestPage/RequestPagePost, which would try to re-acquire the lock and deadlock. Unlike the
+// content client, authClient follows redirects the engine's SSOEngine.FollowRedirect allows.
+func (c *Client) AuthenticatingClient() *http.Client {
+	return &c.authClient
+}
 
-	if err := c.Authenticate(); err != nil {
-		return nil, err
-	}
+// PostGenericLoginForm is the exported form of postGenericLoginForm, for UniversityEngine
+// implementations outside this package that need to fall back to the generic PeopleSoft login
+// form once any provider-specific redirect chain (e.g. an SSO handshake) has been resolved.
+func (c *Client) PostGenericLoginForm(authPageURL string) (*http.Response, error) {
+	ctx, cancel := c.boundContext(context.Background())
+	defer cancel()
+	return c.PostGenericLoginFormContext(ctx, authPageURL)
+}
 
-	c.authLock.RLock()
-	resp, err = c.client.Get(requestURL)
-	c.authLock.RUnlock()
-	if err != nil {
-		if resp != nil {
-			resp.Body.Close()
-		}
-		return nil, err
-	} else {
-		return resp, nil
-	}
+// PostGenericLoginFormContext is like PostGenericLoginForm, but binds the GET of authPageURL and
+// the login POST to ctx.
+func (c *Client) PostGenericLoginFormContext(ctx context.Context, authPageURL string) (*http.Response, error) {
+	return c.postGenericLoginForm(ctx, authPageURL)
+}
+
+// InvalidateCredentials tells the configured CredentialProvider that the credentials it last
+// returned were rejected, so it can prompt for or fetch fresh ones on the next Credentials call.
+// UniversityEngine implementations should call this as soon as they recognize an auth-failure
+// page coming back from a login POST.
+func (c *Client) InvalidateCredentials() {
+	c.creds.Invalidate()
 }
 
 // postGenericLoginForm uses parseGenericLoginForm on the given page and POSTs the username and
-// password. It may fail at several points. If all is successful, it returns the result of the POST.
+// password obtained from c.creds. It may fail at several points. If all is successful, it returns
+// the result of the POST.
 //
 // Since this should only be called during authentication, it assumes that c.authLock is already
 // locked in write mode.
 //
 // If the post results in a redirect, this may return a non-nil response with a non-nil error.
-func (c *Client) postGenericLoginForm(authPageURL string) (*http.Response, error) {
-	res, err := c.client.Get(authPageURL)
+func (c *Client) postGenericLoginForm(ctx context.Context, authPageURL string) (*http.Response, error) {
+	getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, authPageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.authClient.Do(getReq)
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -195,11 +455,21 @@ func (c *Client) postGenericLoginForm(authPageURL string) (*http.Response, error
 		return nil, err
 	}
 
+	username, password, err := c.creds.Credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	fields := formInfo.otherFields
-	fields.Add(formInfo.usernameField, c.username)
-	fields.Add(formInfo.passwordField, c.password)
+	fields.Add(formInfo.usernameField, username)
+	fields.Add(formInfo.passwordField, password)
 
-	return c.client.PostForm(formInfo.action, fields)
+	postReq, err := http.NewRequestWithContext(ctx, http.MethodPost, formInfo.action, strings.NewReader(fields.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	postReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.authClient.Do(postReq)
 }
 
 // isRedirectError returns true if an error is a redirectionRejectedError wrapped in url.Error.
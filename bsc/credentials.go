@@ -0,0 +1,147 @@
+package bsc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// CredentialProvider supplies the username and password a Client uses to authenticate, and is
+// notified when those credentials are rejected. Implementations may prompt a user, read from a
+// secret manager, or simply return a fixed pair (see StaticCredentials).
+type CredentialProvider interface {
+	// Credentials returns the username and password to authenticate with. It is called for
+	// every login attempt, so an implementation backed by a secret manager or an expiring
+	// prompt is free to return a different value each time.
+	Credentials(ctx context.Context) (username, password string, err error)
+
+	// Invalidate is called when a login POST comes back with an auth-failure page, so the
+	// provider can discard any cached secret and fetch or prompt for a fresh one on the next
+	// call to Credentials.
+	Invalidate()
+}
+
+// staticCredentials is a CredentialProvider that always returns the same username and password.
+type staticCredentials struct {
+	username string
+	password string
+}
+
+// StaticCredentials returns a CredentialProvider for a fixed username/password pair. It is the
+// thin wrapper that replaces passing username and password directly to NewClient.
+func StaticCredentials(username, password string) CredentialProvider {
+	return staticCredentials{username: username, password: password}
+}
+
+func (s staticCredentials) Credentials(ctx context.Context) (string, string, error) {
+	return s.username, s.password, nil
+}
+
+func (s staticCredentials) Invalidate() {}
+
+// KeyringCredentials is a CredentialProvider backed by the OS keychain, via
+// github.com/zalando/go-keyring. The password is stored under Service/Username; Invalidate
+// deletes it, so the next Credentials call returns an error until something else sets it again.
+type KeyringCredentials struct {
+	Service  string
+	Username string
+}
+
+// NewKeyringCredentials returns a KeyringCredentials for the given service and username.
+func NewKeyringCredentials(service, username string) *KeyringCredentials {
+	return &KeyringCredentials{Service: service, Username: username}
+}
+
+func (k *KeyringCredentials) Credentials(ctx context.Context) (string, string, error) {
+	password, err := keyring.Get(k.Service, k.Username)
+	if err != nil {
+		return "", "", fmt.Errorf("keyring credentials: %w", err)
+	}
+	return k.Username, password, nil
+}
+
+func (k *KeyringCredentials) Invalidate() {
+	_ = keyring.Delete(k.Service, k.Username)
+}
+
+// NetrcCredentials is a CredentialProvider backed by a .netrc-style file, looked up by machine
+// name (typically the Student Center's host). Invalidate is a no-op: a rejected .netrc entry
+// requires the user to edit the file themselves.
+type NetrcCredentials struct {
+	// Path is the .netrc file to read. If empty, $NETRC is used, falling back to
+	// $HOME/.netrc.
+	Path string
+
+	// Machine is the "machine" entry to look up, typically the Student Center's hostname.
+	Machine string
+}
+
+// NewNetrcCredentials returns a NetrcCredentials that looks up machine in the default .netrc
+// location.
+func NewNetrcCredentials(machine string) *NetrcCredentials {
+	return &NetrcCredentials{Machine: machine}
+}
+
+func (n *NetrcCredentials) Credentials(ctx context.Context) (string, string, error) {
+	path := n.Path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", fmt.Errorf("netrc credentials: %w", err)
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	username, password, err := lookupNetrcMachine(path, n.Machine)
+	if err != nil {
+		return "", "", fmt.Errorf("netrc credentials: %w", err)
+	}
+	return username, password, nil
+}
+
+func (n *NetrcCredentials) Invalidate() {}
+
+// lookupNetrcMachine does a minimal parse of path for a "machine <name> login <user> password
+// <pass>" entry, the subset of the .netrc format used for this purpose.
+func lookupNetrcMachine(path, machine string) (username, password string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	var fields []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields = append(fields, strings.Fields(scanner.Text())...)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	for i := 0; i < len(fields); i++ {
+		if fields[i] != "machine" || i+1 >= len(fields) || fields[i+1] != machine {
+			continue
+		}
+		for j := i + 2; j+1 < len(fields) && fields[j] != "machine"; j += 2 {
+			switch fields[j] {
+			case "login":
+				username = fields[j+1]
+			case "password":
+				password = fields[j+1]
+			}
+		}
+		if username != "" || password != "" {
+			return username, password, nil
+		}
+	}
+	return "", "", fmt.Errorf("no entry for machine %q in %s", machine, path)
+}
@@ -0,0 +1,50 @@
+package bsc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeNetrc(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("write netrc: %v", err)
+	}
+	return path
+}
+
+func TestLookupNetrcMachineFindsMatchingEntry(t *testing.T) {
+	path := writeNetrc(t, `
+machine sc.other.edu login otheruser password otherpass
+machine sc.example.edu
+	login student
+	password hunter2
+machine sc.third.edu login thirduser password thirdpass
+`)
+
+	username, password, err := lookupNetrcMachine(path, "sc.example.edu")
+	if err != nil {
+		t.Fatalf("lookupNetrcMachine: %v", err)
+	}
+	if username != "student" || password != "hunter2" {
+		t.Errorf("lookupNetrcMachine = (%q, %q), want (%q, %q)", username, password, "student", "hunter2")
+	}
+}
+
+func TestLookupNetrcMachineNoMatchingEntry(t *testing.T) {
+	path := writeNetrc(t, "machine sc.other.edu login otheruser password otherpass\n")
+
+	if _, _, err := lookupNetrcMachine(path, "sc.example.edu"); err == nil {
+		t.Fatal("lookupNetrcMachine: expected error for missing machine, got nil")
+	}
+}
+
+func TestLookupNetrcMachineMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist")
+
+	if _, _, err := lookupNetrcMachine(path, "sc.example.edu"); err == nil {
+		t.Fatal("lookupNetrcMachine: expected error for missing file, got nil")
+	}
+}
@@ -0,0 +1,160 @@
+package bsc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// SessionExpiredDetector may optionally be implemented by a UniversityEngine whose Student Center
+// signals an expired session by rendering a page (HTTP 200) rather than redirecting back to login
+// - a "your session has timed out" page, say. When present, requestWithRetry gives it a look at
+// every otherwise-successful response, alongside the existing redirect-based detection, before
+// treating it as real content.
+type SessionExpiredDetector interface {
+	// SessionExpired reports whether resp is such a page. It may consume resp.Body; the caller
+	// replaces it afterwards so the rest of the response is unaffected.
+	SessionExpired(resp *http.Response) bool
+}
+
+// RetryPolicy controls how RequestPageContext and RequestPagePostContext retry transient
+// failures: network errors and 5xx responses are retried with exponential backoff and jitter; a
+// detected session-expiry (a redirect back to the login page) triggers a single re-authentication
+// and retry that does not count further against MaxAttempts; 4xx responses are returned
+// immediately without retrying.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent before giving up, including
+	// the first attempt. It does not count the one extra retry following a re-authentication.
+	MaxAttempts int
+
+	// InitialDelay is the backoff before the first retry.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the backoff between retries.
+	MaxDelay time.Duration
+
+	// Multiplier scales the delay after each retry, before jitter is applied.
+	Multiplier float64
+}
+
+// defaultRetryPolicy is applied by NewClient unless overridden with WithRetryPolicy.
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     8 * time.Second,
+	Multiplier:   2,
+}
+
+// WithRetryPolicy overrides the default RetryPolicy used by RequestPage, RequestPagePost, and
+// their …Context variants.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// requestWithRetry sends the request built by buildRequest, retrying according to c.retryPolicy.
+// buildRequest is called again before every attempt, since an *http.Request (and any body reader
+// it wraps) can only be sent once.
+func (c *Client) requestWithRetry(ctx context.Context, buildRequest func() (*http.Request, error)) (*http.Response, error) {
+	policy := c.retryPolicy
+	delay := policy.InitialDelay
+	reauthenticated := false
+
+	var lastErr error
+	for attempt := 1; ; {
+		req, err := buildRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			if isRedirectError(err) && !reauthenticated {
+				resp.Body.Close()
+				reauthenticated = true
+				if err := c.AuthenticateContext(ctx); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if isRedirectError(err) {
+				return nil, err
+			}
+			lastErr = err
+		} else if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("bsc: server returned %s", resp.Status)
+		} else if resp.StatusCode < 300 && sessionExpired(c.uni, resp) {
+			resp.Body.Close()
+			if !reauthenticated {
+				reauthenticated = true
+				if err := c.AuthenticateContext(ctx); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, errors.New("bsc: session still expired after re-authentication")
+		} else {
+			// Includes 4xx: fail immediately without retrying, same as a successful request.
+			c.saveSessionIfChanged(resp)
+			return resp, nil
+		}
+
+		if attempt >= policy.MaxAttempts {
+			return nil, lastErr
+		}
+		if err := sleepWithJitter(ctx, delay); err != nil {
+			return nil, err
+		}
+		delay = nextDelay(delay, policy)
+		attempt++
+	}
+}
+
+// nextDelay scales d by policy.Multiplier, capped at policy.MaxDelay.
+func nextDelay(d time.Duration, policy RetryPolicy) time.Duration {
+	next := time.Duration(float64(d) * policy.Multiplier)
+	if next > policy.MaxDelay {
+		next = policy.MaxDelay
+	}
+	return next
+}
+
+// sessionExpired reports whether uni implements SessionExpiredDetector and flags resp as an
+// expired-session page. resp.Body is buffered and replaced so the rest of the response is
+// unaffected regardless of the outcome.
+func sessionExpired(uni UniversityEngine, resp *http.Response) bool {
+	detector, ok := uni.(SessionExpiredDetector)
+	if !ok {
+		return false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return false
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	expired := detector.SessionExpired(resp)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return expired
+}
+
+// sleepWithJitter sleeps for d ± 25%, returning early with ctx.Err() if ctx is done first.
+func sleepWithJitter(ctx context.Context, d time.Duration) error {
+	jittered := time.Duration(float64(d) * (0.75 + rand.Float64()*0.5))
+	timer := time.NewTimer(jittered)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
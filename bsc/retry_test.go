@@ -0,0 +1,49 @@
+package bsc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNextDelayScalesByMultiplier(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 500 * time.Millisecond, MaxDelay: 8 * time.Second, Multiplier: 2}
+
+	got := nextDelay(500*time.Millisecond, policy)
+	if want := time.Second; got != want {
+		t.Errorf("nextDelay = %v, want %v", got, want)
+	}
+}
+
+func TestNextDelayCapsAtMaxDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 500 * time.Millisecond, MaxDelay: 3 * time.Second, Multiplier: 2}
+
+	got := nextDelay(2*time.Second, policy)
+	if want := policy.MaxDelay; got != want {
+		t.Errorf("nextDelay = %v, want %v (capped)", got, want)
+	}
+}
+
+func TestSleepWithJitterStaysWithinBounds(t *testing.T) {
+	d := 100 * time.Millisecond
+	start := time.Now()
+	if err := sleepWithJitter(context.Background(), d); err != nil {
+		t.Fatalf("sleepWithJitter: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// ±25% jitter, with slack for scheduling overhead on a loaded test machine.
+	if elapsed < 70*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("sleepWithJitter(%v) slept for %v, want roughly within ±25%%", d, elapsed)
+	}
+}
+
+func TestSleepWithJitterReturnsEarlyWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sleepWithJitter(ctx, time.Minute)
+	if err != context.Canceled {
+		t.Errorf("sleepWithJitter with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
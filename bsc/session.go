@@ -0,0 +1,78 @@
+package bsc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+)
+
+// HostCookies pairs a set of cookies with the origin (scheme + host) they were issued for.
+// cookiejar.Jar scopes cookies by domain, so a flat cookie list loses that association; grouping
+// by Origin is what lets loadSession hand each group back to Jar.SetCookies for the right URL.
+type HostCookies struct {
+	// Origin is the scheme://host the cookies below apply to, e.g. "https://sc.example.edu/" (as
+	// written by the Client, with a trailing slash).
+	Origin string `json:"origin"`
+
+	Cookies []*http.Cookie `json:"cookies"`
+}
+
+// SessionStore persists a Client's cookie jar across process restarts, so a short-lived process
+// (a cron job, a CLI invocation) doesn't have to pay the cost of a full re-authentication every
+// time it runs. It persists cookies per host, since an SSO-fronted Client holds cookies for both
+// the Student Center and its identity provider. Set it via WithSessionStore.
+type SessionStore interface {
+	// Load returns the cookies to rehydrate the jar with, grouped by host, or (nil, nil) if
+	// there is no stored session yet.
+	Load() ([]HostCookies, error)
+
+	// Save persists hosts, replacing whatever was previously stored.
+	Save(hosts []HostCookies) error
+
+	// Delete removes any persisted session. It is called by Client.Logout.
+	Delete() error
+}
+
+// fileSessionStore is a SessionStore backed by a JSON file on disk.
+type fileSessionStore struct {
+	path string
+}
+
+// FileSessionStore returns a SessionStore that serializes the cookie jar to a JSON file at path,
+// written with 0600 permissions.
+func FileSessionStore(path string) SessionStore {
+	return &fileSessionStore{path: path}
+}
+
+func (f *fileSessionStore) Load() ([]HostCookies, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []HostCookies
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+func (f *fileSessionStore) Save(hosts []HostCookies) error {
+	data, err := json.Marshal(hosts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.path, data, 0600)
+}
+
+func (f *fileSessionStore) Delete() error {
+	err := os.Remove(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package bsc
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSessionStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	store := FileSessionStore(path)
+
+	hosts := []HostCookies{
+		{
+			Origin: "https://sc.example.edu",
+			Cookies: []*http.Cookie{
+				{Name: "PS_TOKEN", Value: "abc123"},
+			},
+		},
+		{
+			Origin: "https://login.example.edu",
+			Cookies: []*http.Cookie{
+				{Name: "JSESSIONID", Value: "xyz789"},
+			},
+		},
+	}
+
+	if err := store.Save(hosts); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(got) != len(hosts) {
+		t.Fatalf("Load returned %d hosts, want %d", len(got), len(hosts))
+	}
+	for i, host := range hosts {
+		if got[i].Origin != host.Origin {
+			t.Errorf("host %d: Origin = %q, want %q", i, got[i].Origin, host.Origin)
+		}
+		if len(got[i].Cookies) != 1 || got[i].Cookies[0].Name != host.Cookies[0].Name || got[i].Cookies[0].Value != host.Cookies[0].Value {
+			t.Errorf("host %d: Cookies = %+v, want %+v", i, got[i].Cookies, host.Cookies)
+		}
+	}
+}
+
+func TestFileSessionStoreLoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist.json")
+	store := FileSessionStore(path)
+
+	hosts, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if hosts != nil {
+		t.Errorf("Load on a missing file = %+v, want nil", hosts)
+	}
+}
+
+func TestFileSessionStoreDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	store := FileSessionStore(path)
+
+	if err := store.Save([]HostCookies{{Origin: "https://sc.example.edu"}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	hosts, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load after Delete: %v", err)
+	}
+	if hosts != nil {
+		t.Errorf("Load after Delete = %+v, want nil", hosts)
+	}
+}
+
+func TestFileSessionStoreDeleteMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "does-not-exist.json")
+	store := FileSessionStore(path)
+
+	if err := store.Delete(); err != nil {
+		t.Errorf("Delete on a missing file: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package sso provides reusable UniversityEngine helpers for Student Centers that sit behind a
+// SAML/Shibboleth identity provider rather than presenting a plain login form directly.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"github.com/5l1v3r1/better-student-center/bsc"
+)
+
+// ShibbolethEngine is a bsc.UniversityEngine (and bsc.SSOEngine) for universities whose
+// PeopleSoft Student Center is fronted by a Shibboleth/SAML identity provider. Authenticate GETs
+// LoginURL; if that lands on the IdP's SAMLResponse auto-post form, it submits the form back to the
+// service provider's assertion consumer service and then runs bsc.Client's generic PeopleSoft
+// login form on the page that follows. If LoginURL instead lands on a plain login form, that form
+// is submitted through the generic login flow and Authenticate returns: a SAMLResponse auto-post
+// page that the IdP sends back after that login is not submitted to the ACS.
+type ShibbolethEngine struct {
+	// Root is the PeopleSoft Student Center root URL, e.g. "https://sc.example.edu/psp/ps".
+	Root string
+
+	// LoginURL is the page that kicks off the SSO flow, usually a PeopleSoft URL that itself
+	// redirects to the IdP.
+	LoginURL string
+
+	// IdPHost and SPHost are the only hosts FollowRedirect allows: the identity provider (e.g.
+	// "login.example.edu") and the service provider fronting PeopleSoft (e.g.
+	// "sc.example.edu"). Redirects to any other host are rejected.
+	IdPHost string
+	SPHost  string
+}
+
+// RootURL returns the PeopleSoft Student Center root URL.
+func (e *ShibbolethEngine) RootURL() string {
+	return e.Root
+}
+
+// FollowRedirect implements bsc.SSOEngine. It allows redirects within the IdP/SP whitelist and
+// rejects everything else, including chains longer than 10 hops.
+func (e *ShibbolethEngine) FollowRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("sso: too many redirects")
+	}
+	host := req.URL.Hostname()
+	if host != e.IdPHost && host != e.SPHost {
+		return fmt.Errorf("sso: refusing to follow redirect to untrusted host %q", host)
+	}
+	return nil
+}
+
+// Authenticate implements bsc.UniversityEngine. It is called with c.authLock already held in
+// write mode, so it talks to c.AuthenticatingClient() directly rather than through
+// c.RequestPage/c.RequestPagePost. Every request it makes is bound to ctx, so a cancelled or
+// expired context aborts the handshake instead of leaving authLock held indefinitely.
+func (e *ShibbolethEngine) Authenticate(ctx context.Context, c *bsc.Client) error {
+	httpClient := c.AuthenticatingClient()
+
+	loginReq, err := http.NewRequestWithContext(ctx, http.MethodGet, e.LoginURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Do(loginReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	form, err := parseSAMLPostForm(res)
+	if err != nil {
+		// Not a SAML auto-post page: assume the IdP landed us on its own plain login form and
+		// hand off to the generic PeopleSoft login flow.
+		return finishGenericLogin(ctx, c, res.Request.URL.String())
+	}
+
+	acsReq, err := http.NewRequestWithContext(ctx, http.MethodPost, form.action, strings.NewReader(form.fields.Encode()))
+	if err != nil {
+		return err
+	}
+	acsReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	acsRes, err := httpClient.Do(acsReq)
+	if err != nil {
+		return err
+	}
+	defer acsRes.Body.Close()
+
+	if _, err := parseSAMLPostForm(acsRes); err == nil {
+		return errors.New("sso: unexpected second SAML hop, IdP/SP configuration may be wrong")
+	}
+
+	return finishGenericLogin(ctx, c, acsRes.Request.URL.String())
+}
+
+// finishGenericLogin POSTs the generic PeopleSoft login form at authPageURL and invalidates the
+// credentials that were just tried via c.InvalidateCredentials if the login was rejected, so the
+// next Authenticate attempt fetches or prompts for a fresh secret instead of repeating a bad one.
+func finishGenericLogin(ctx context.Context, c *bsc.Client, authPageURL string) error {
+	res, err := c.PostGenericLoginFormContext(ctx, authPageURL)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if loginRejected(res, c.InvalidateCredentials) {
+		return fmt.Errorf("sso: login rejected with status %s", res.Status)
+	}
+	return nil
+}
+
+// loginRejected reports whether res, the response to the generic login POST, indicates the
+// credentials were rejected rather than accepted, calling invalidate if so. PeopleSoft signals a
+// rejected login with its own 200 page rather than a 4xx status in some deployments, but a 4xx (or
+// worse) is the one signal available without engine-specific page markers.
+func loginRejected(res *http.Response, invalidate func()) bool {
+	if res.StatusCode < 400 {
+		return false
+	}
+	invalidate()
+	return true
+}
+
+// samlPostForm holds the fields of an IdP's SAMLResponse auto-post form.
+type samlPostForm struct {
+	action string
+	fields url.Values
+}
+
+// parseSAMLPostForm extracts the SAMLResponse (and RelayState, if present) auto-post form that a
+// Shibboleth IdP renders after a successful login. It returns an error if res's body does not
+// contain such a form.
+func parseSAMLPostForm(res *http.Response) (*samlPostForm, error) {
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	formNode := findFormWithField(doc, "SAMLResponse")
+	if formNode == nil {
+		return nil, errors.New("sso: no SAMLResponse form found")
+	}
+
+	action, ok := attr(formNode, "action")
+	if !ok || action == "" {
+		return nil, errors.New("sso: SAMLResponse form has no action")
+	}
+	actionURL, err := res.Request.URL.Parse(action)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := url.Values{}
+	for _, input := range findAll(formNode, "input") {
+		name, ok := attr(input, "name")
+		if !ok || name == "" {
+			continue
+		}
+		value, _ := attr(input, "value")
+		fields.Add(name, value)
+	}
+
+	return &samlPostForm{action: actionURL.String(), fields: fields}, nil
+}
+
+// findFormWithField returns the first <form> under n that contains an <input> whose name matches
+// fieldName, or nil if there is none.
+func findFormWithField(n *html.Node, fieldName string) *html.Node {
+	var found *html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if found != nil {
+			return
+		}
+		if node.Type == html.ElementNode && node.Data == "form" {
+			for _, input := range findAll(node, "input") {
+				if name, ok := attr(input, "name"); ok && name == fieldName {
+					found = node
+					return
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// findAll returns every descendant of n (inclusive) whose tag matches tag.
+func findAll(n *html.Node, tag string) []*html.Node {
+	var matches []*html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == tag {
+			matches = append(matches, node)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return matches
+}
+
+// attr returns the value of n's attribute named key, and whether it was present.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,107 @@
+package sso
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func responseFor(t *testing.T, rawURL, body string) *http.Response {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse %q: %v", rawURL, err)
+	}
+	return &http.Response{
+		Request: &http.Request{URL: u},
+		Body:    io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestParseSAMLPostFormExtractsActionAndFields(t *testing.T) {
+	res := responseFor(t, "https://login.example.edu/idp/profile/SAML2/POST/SSO", `
+		<html><body onload="document.forms[0].submit()">
+			<form action="/Shibboleth.sso/SAML2/POST" method="post">
+				<input type="hidden" name="RelayState" value="cookie:123" />
+				<input type="hidden" name="SAMLResponse" value="opaque-assertion" />
+			</form>
+		</body></html>`)
+
+	form, err := parseSAMLPostForm(res)
+	if err != nil {
+		t.Fatalf("parseSAMLPostForm: %v", err)
+	}
+	if want := "https://login.example.edu/Shibboleth.sso/SAML2/POST"; form.action != want {
+		t.Errorf("action = %q, want %q", form.action, want)
+	}
+	if got := form.fields.Get("SAMLResponse"); got != "opaque-assertion" {
+		t.Errorf("SAMLResponse field = %q, want %q", got, "opaque-assertion")
+	}
+	if got := form.fields.Get("RelayState"); got != "cookie:123" {
+		t.Errorf("RelayState field = %q, want %q", got, "cookie:123")
+	}
+}
+
+func TestParseSAMLPostFormRejectsPageWithoutSAMLResponse(t *testing.T) {
+	res := responseFor(t, "https://login.example.edu/idp/profile/SAML2/POST/SSO", `
+		<html><body>
+			<form action="/idp/profile/SAML2/POST/SSO" method="post">
+				<input type="text" name="j_username" />
+				<input type="password" name="j_password" />
+			</form>
+		</body></html>`)
+
+	if _, err := parseSAMLPostForm(res); err == nil {
+		t.Fatal("parseSAMLPostForm: expected error for a plain login form, got nil")
+	}
+}
+
+func TestLoginRejectedInvalidatesOn4xx(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+
+	invalidated := false
+	if !loginRejected(res, func() { invalidated = true }) {
+		t.Error("loginRejected(401) = false, want true")
+	}
+	if !invalidated {
+		t.Error("loginRejected(401) did not call invalidate")
+	}
+}
+
+func TestLoginRejectedLeavesCredentialsOnSuccess(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusOK, Status: "200 OK"}
+
+	invalidated := false
+	if loginRejected(res, func() { invalidated = true }) {
+		t.Error("loginRejected(200) = true, want false")
+	}
+	if invalidated {
+		t.Error("loginRejected(200) called invalidate, want it untouched")
+	}
+}
+
+func TestFindFormWithFieldSkipsFormsWithoutTheField(t *testing.T) {
+	res := responseFor(t, "https://login.example.edu/", `
+		<html><body>
+			<form id="login"><input name="j_username" /></form>
+			<form id="saml"><input name="SAMLResponse" /></form>
+		</body></html>`)
+
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		t.Fatalf("html.Parse: %v", err)
+	}
+
+	form := findFormWithField(doc, "SAMLResponse")
+	if form == nil {
+		t.Fatal("findFormWithField: got nil, want the #saml form")
+	}
+	id, _ := attr(form, "id")
+	if id != "saml" {
+		t.Errorf("findFormWithField returned form %q, want %q", id, "saml")
+	}
+}